@@ -0,0 +1,34 @@
+package gen
+
+// Ext type numbers used when generating code for the arbitrary-precision
+// primitives (BigInt, BigFloat, Decimal). These are registered by the
+// generated init() via msgp.RegisterExtension so that the wire-level ext
+// type byte is stable across processes, languages, and generator runs.
+// They live in the user-assignable range (-1 through -128 are reserved
+// for msgp/the spec; 0-127 are free for application use), chosen far
+// enough from zero that they're unlikely to collide with a user's own
+// extension types.
+const (
+	ExtBigInt   int8 = 100 // math/big.Int, via (*big.Int).GobEncode's canonical form
+	ExtBigFloat int8 = 101 // math/big.Float, via (*big.Float).GobEncode's canonical form
+	ExtDecimal  int8 = 102 // pluggable decimal.Decimal, via its own GobEncode-equivalent pair
+)
+
+// bignumExtType returns the ext type number generated code should use to
+// shim p, and whether p is one of the arbitrary-precision primitives at
+// all. BigInt/BigFloat/Decimal are all written as msgp.Extension values:
+// the generated MarshalMsg/UnmarshalMsg calls the type's own canonical
+// byte-form method (GobEncode/GobDecode for the big.* types, an
+// equivalent pair for the registered decimal type) and wraps the result
+// in an ext header carrying one of these numbers.
+func bignumExtType(p Primitive) (int8, bool) {
+	switch p {
+	case BigInt:
+		return ExtBigInt, true
+	case BigFloat:
+		return ExtBigFloat, true
+	case Decimal:
+		return ExtDecimal, true
+	}
+	return 0, false
+}
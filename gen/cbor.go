@@ -0,0 +1,667 @@
+package gen
+
+import (
+	"fmt"
+	"io"
+)
+
+// CBOR tag numbers used for the built-in Primitive kinds that don't map
+// onto a bare major type. See https://www.iana.org/assignments/cbor-tags.
+const (
+	cborTagTime    = 1 // tag 1: epoch-based date/time (time.Time)
+	cborTagDecimal = 4 // tag 4: decimal fraction (json.Number)
+)
+
+// cborSignedIntPrimitives and cborUnsignedIntPrimitives classify every
+// integer Primitive kind that doesn't get its own dedicated
+// genEncodeBase/genDecodeBase case, so the shared default branch can pick
+// the cbor.AppendInt/ReadIntBytes or cbor.AppendUint/ReadUintBytes pair
+// that actually matches the field's declared width instead of assuming
+// every such field is an int64. time.Duration is signed (its underlying
+// type is int64); the rest are exactly the bare sized int/uint aliases
+// the primitives table in elem.go recognizes.
+var cborSignedIntPrimitives = map[Primitive]bool{
+	Int: true, Int8: true, Int16: true, Int32: true, Int64: true, Duration: true,
+}
+
+var cborUnsignedIntPrimitives = map[Primitive]bool{
+	Uint: true, Uint8: true, Uint16: true, Uint32: true, Uint64: true, Byte: true,
+}
+
+// cborPrinter walks an Elem tree and emits the Go source for the
+// MarshalCBOR/UnmarshalCBOR method pair, calling into the standalone
+// msgpcbor package (aliased "cbor" in generated output) for the actual wire
+// primitives. It mirrors the role the msgp writer plays for the MessagePack
+// backend: same Elem tree, same shim/ident/allownil/omitempty handling,
+// different wire format.
+type cborPrinter struct {
+	w   io.Writer
+	err error
+}
+
+func cborPrintf(p *cborPrinter, format string, args ...interface{}) {
+	if p.err != nil {
+		return
+	}
+	_, p.err = fmt.Fprintf(p.w, format, args...)
+}
+
+// marshalCBOR appends the generated MarshalCBOR method for e to w.
+func marshalCBOR(w io.Writer, e Elem) error {
+	if !IsPrintable(e) {
+		return nil
+	}
+	p := &cborPrinter{w: w}
+	cborPrintf(p, "// MarshalCBOR implements the cbor.Marshaler interface.\n")
+	cborPrintf(p, "func (%s %s) MarshalCBOR(b []byte) ([]byte, error) {\n", e.Varname(), e.TypeName())
+	cborPrintf(p, "\tvar err error\n")
+	p.genEncode(e)
+	cborPrintf(p, "\treturn b, nil\n}\n\n")
+	return p.err
+}
+
+// unmarshalCBOR appends the generated UnmarshalCBOR method for e to w.
+func unmarshalCBOR(w io.Writer, e Elem) error {
+	if !IsPrintable(e) {
+		return nil
+	}
+	p := &cborPrinter{w: w}
+	cborPrintf(p, "// UnmarshalCBOR implements the cbor.Unmarshaler interface.\n")
+	cborPrintf(p, "func (%s %s) UnmarshalCBOR(b []byte) ([]byte, error) {\n", e.Varname(), e.TypeName())
+	cborPrintf(p, "\tvar err error\n")
+	p.genDecode(e)
+	cborPrintf(p, "\treturn b, nil\n}\n\n")
+	return p.err
+}
+
+// withNilGuard wraps body in a "if v == nil { append nil } else { body }"
+// when allowNil is set, reusing the same isAllowNil flag the MessagePack
+// backend honors (see Slice/Map.SetIsAllowNil). Otherwise body runs
+// unconditionally.
+func (p *cborPrinter) withNilGuard(varname string, allowNil bool, body func()) {
+	if !allowNil {
+		body()
+		return
+	}
+	cborPrintf(p, "\tif %s == nil {\n\t\tb = cbor.AppendNil(b)\n\t} else {\n", varname)
+	body()
+	cborPrintf(p, "\t}\n")
+}
+
+// genEncode emits the header + body needed to write e as CBOR.
+func (p *cborPrinter) genEncode(e Elem) {
+	switch x := e.(type) {
+	case *Struct:
+		p.genEncodeStruct(x)
+	case *Array:
+		cborPrintf(p, "\tb = cbor.AppendArrayHeader(b, uint64(%s))\n", x.Size)
+		cborPrintf(p, "\tfor %s := range %s {\n", x.Index, x.Varname())
+		p.genEncode(x.Els)
+		cborPrintf(p, "\t}\n")
+	case *Slice:
+		if kind := x.FastpathKind(); kind != "" {
+			p.withNilGuard(x.Varname(), x.isAllowNil, func() {
+				cborPrintf(p, "\tb = %s(b, %s)\n", fastpathEncFunc(kind), x.Varname())
+			})
+			return
+		}
+		p.withNilGuard(x.Varname(), x.isAllowNil, func() {
+			cborPrintf(p, "\tb = cbor.AppendArrayHeader(b, uint64(len(%s)))\n", x.Varname())
+			cborPrintf(p, "\tfor %s := range %s {\n", x.Index, x.Varname())
+			p.genEncode(x.Els)
+			cborPrintf(p, "\t}\n")
+		})
+	case *Map:
+		if kind := x.FastpathKind(); kind != "" {
+			p.withNilGuard(x.Varname(), x.isAllowNil, func() {
+				cborPrintf(p, "\tb = %s(b, %s)\n", fastpathEncFunc(kind), x.Varname())
+			})
+			return
+		}
+		p.withNilGuard(x.Varname(), x.isAllowNil, func() {
+			cborPrintf(p, "\tb = cbor.AppendMapHeader(b, uint64(len(%s)))\n", x.Varname())
+			cborPrintf(p, "\tfor %s, %s := range %s {\n", x.Keyidx, x.Validx, x.Varname())
+			cborPrintf(p, "\t\tb = cbor.AppendString(b, %s)\n", x.Keyidx)
+			p.genEncode(x.Value)
+			cborPrintf(p, "\t}\n")
+		})
+	case *Ptr:
+		p.genEncode(x.Value)
+	case *BaseElem:
+		p.genEncodeBase(x)
+	}
+}
+
+// genEncodeStruct emits a struct's header plus one write per field. A
+// `,extra` catch-all field (see Struct.Extra), when present, is folded
+// into the same CBOR map: its entries are appended after the declared
+// fields, each value re-emitted verbatim from the raw bytes
+// genDecodeStruct captured for that unknown key, so a decode/encode
+// round-trip preserves fields this Go type doesn't know about.
+func (p *cborPrinter) genEncodeStruct(s *Struct) {
+	fields := declaredFields(s)
+	extra := s.Extra()
+	if err := validateCBORKeys(fields); err != nil {
+		if p.err == nil {
+			p.err = err
+		}
+		return
+	}
+	if err := s.ValidateExtra(); err != nil {
+		if p.err == nil {
+			p.err = err
+		}
+		return
+	}
+	if s.AsTuple {
+		cborPrintf(p, "\tb = cbor.AppendArrayHeader(b, uint64(%d))\n", len(fields))
+		for i := range fields {
+			p.genEncode(fields[i].FieldElem)
+		}
+		return
+	}
+
+	szVar := randIdent()
+	cborPrintf(p, "\t%s := uint64(%d)\n", szVar, len(fields))
+	for i := range fields {
+		f := fields[i]
+		if f.HasTagPart("omitempty") {
+			if iz := f.FieldElem.IfZeroExpr(); iz != "" {
+				cborPrintf(p, "\tif %s {\n\t\t%s--\n\t}\n", iz, szVar)
+			}
+		}
+	}
+	if extra != nil {
+		if _, ok := extra.FieldElem.(*Map); ok {
+			cborPrintf(p, "\t%s += uint64(len(%s))\n", szVar, extra.FieldElem.Varname())
+		} else {
+			// A bare msgp.Raw catch-all holds zero or more already-encoded
+			// key+value pairs back to back; count them by skipping each
+			// pair in turn over a throwaway copy of the bytes.
+			cntVar, tmpVar := randIdent(), randIdent()
+			cborPrintf(p, "\tvar %s uint64\n", cntVar)
+			cborPrintf(p, "\t%s := []byte(%s)\n", tmpVar, extra.FieldElem.Varname())
+			cborPrintf(p, "\tfor len(%s) > 0 {\n", tmpVar)
+			cborPrintf(p, "\t\t%s, err = cbor.Skip(%s)\n", tmpVar, tmpVar)
+			cborPrintf(p, "\t\tif err != nil {\n\t\t\treturn nil, err\n\t\t}\n")
+			cborPrintf(p, "\t\t%s, err = cbor.Skip(%s)\n", tmpVar, tmpVar)
+			cborPrintf(p, "\t\tif err != nil {\n\t\t\treturn nil, err\n\t\t}\n")
+			cborPrintf(p, "\t\t%s++\n", cntVar)
+			cborPrintf(p, "\t}\n")
+			cborPrintf(p, "\t%s += %s\n", szVar, cntVar)
+		}
+	}
+	cborPrintf(p, "\tb = cbor.AppendMapHeader(b, %s)\n", szVar)
+	for i := range fields {
+		f := fields[i]
+		omit := f.HasTagPart("omitempty")
+		iz := ""
+		if omit {
+			iz = f.FieldElem.IfZeroExpr()
+		}
+		if omit && iz != "" {
+			cborPrintf(p, "\tif !(%s) {\n", iz)
+		}
+		if key, ok := f.CBORKey(); ok {
+			cborPrintf(p, "\tb = cbor.AppendUint(b, %d)\n", key)
+		} else {
+			cborPrintf(p, "\tb = cbor.AppendString(b, %q)\n", f.FieldTag)
+		}
+		p.genEncode(f.FieldElem)
+		if omit && iz != "" {
+			cborPrintf(p, "\t}\n")
+		}
+	}
+	if extra != nil {
+		if _, ok := extra.FieldElem.(*Map); ok {
+			kVar, vVar := randIdent(), randIdent()
+			cborPrintf(p, "\tfor %s, %s := range %s {\n", kVar, vVar, extra.FieldElem.Varname())
+			if anyCBORKeyed(fields) {
+				// genDecodeStruct stored each unknown integer key in its
+				// decimal string form; write it back as an integer key.
+				numVar := randIdent()
+				cborPrintf(p, "\t\t%s, err := strconv.ParseUint(%s, 10, 64)\n", numVar, kVar)
+				cborPrintf(p, "\t\tif err != nil {\n\t\t\treturn nil, err\n\t\t}\n")
+				cborPrintf(p, "\t\tb = cbor.AppendUint(b, %s)\n", numVar)
+			} else {
+				cborPrintf(p, "\t\tb = cbor.AppendString(b, %s)\n", kVar)
+			}
+			cborPrintf(p, "\t\tb = append(b, %s...)\n", vVar)
+			cborPrintf(p, "\t}\n")
+		} else {
+			// Already-encoded key+value pairs; append verbatim.
+			cborPrintf(p, "\tb = append(b, %s...)\n", extra.FieldElem.Varname())
+		}
+	}
+}
+
+// genEncodeBase emits the CBOR write for a single primitive leaf, applying
+// the field's shim (Convert/ToBase) first, same as the MessagePack backend.
+func (p *cborPrinter) genEncodeBase(b *BaseElem) {
+	expr := b.Varname()
+	if b.Convert {
+		tmp := randIdent()
+		cborPrintf(p, "\t%s := %s(%s)\n", tmp, b.ToBase(), expr)
+		expr = tmp
+	}
+	switch b.Value {
+	case Time:
+		cborPrintf(p, "\tb = cbor.AppendTag(b, %d)\n", cborTagTime)
+		cborPrintf(p, "\tb = cbor.AppendInt(b, %s.Unix())\n", expr)
+	case JsonNumber:
+		cborPrintf(p, "\tb = cbor.AppendTag(b, %d)\n", cborTagDecimal)
+		cborPrintf(p, "\tb = cbor.AppendString(b, string(%s))\n", expr)
+	case String:
+		cborPrintf(p, "\tb = cbor.AppendString(b, %s)\n", expr)
+	case Bytes:
+		cborPrintf(p, "\tb = cbor.AppendBytes(b, %s)\n", expr)
+	case Bool:
+		cborPrintf(p, "\tb = cbor.AppendBool(b, %s)\n", expr)
+	case Float32:
+		cborPrintf(p, "\tb = cbor.AppendFloat64(b, float64(%s))\n", expr)
+	case Float64:
+		cborPrintf(p, "\tb = cbor.AppendFloat64(b, %s)\n", expr)
+	case BigInt, BigFloat, Decimal:
+		// The ext tag is emitted here; the payload that follows it is
+		// written by genEncodeBignumPayload.
+		extType, _ := bignumExtType(b.Value)
+		cborPrintf(p, "\tb = cbor.AppendTag(b, %d)\n", extType)
+		p.genEncodeBignumPayload(expr)
+	case Complex64, Complex128:
+		// No CBOR tag is registered for complex numbers, so they're written
+		// as a plain 2-element array of the real and imaginary parts.
+		cborPrintf(p, "\tb = cbor.AppendArrayHeader(b, 2)\n")
+		cborPrintf(p, "\tb = cbor.AppendFloat64(b, real(complex128(%s)))\n", expr)
+		cborPrintf(p, "\tb = cbor.AppendFloat64(b, imag(complex128(%s)))\n", expr)
+	case Intf, Ext:
+		if p.err == nil {
+			p.err = fmt.Errorf("msgp: cbor: field %q has no CBOR encoding for kind %s", b.Varname(), b.BaseName())
+		}
+	default:
+		if cborUnsignedIntPrimitives[b.Value] {
+			cborPrintf(p, "\tb = cbor.AppendUint(b, uint64(%s))\n", expr)
+		} else {
+			cborPrintf(p, "\tb = cbor.AppendInt(b, int64(%s))\n", expr)
+		}
+	}
+}
+
+// genEncodeBignumPayload appends the GobEncode-canonical byte form of expr
+// (a BigInt/BigFloat/Decimal value, already dereferenced/shimmed by
+// genEncodeBase) as a CBOR byte string, following the ext tag the caller
+// already wrote.
+func (p *cborPrinter) genEncodeBignumPayload(expr string) {
+	tmp := randIdent()
+	cborPrintf(p, "\tvar %s []byte\n", tmp)
+	cborPrintf(p, "\t%s, err = %s.GobEncode()\n", tmp, expr)
+	cborPrintf(p, "\tif err != nil {\n\t\treturn nil, err\n\t}\n")
+	cborPrintf(p, "\tb = cbor.AppendBytes(b, %s)\n", tmp)
+}
+
+// genDecode emits the body needed to read e back out of CBOR.
+func (p *cborPrinter) genDecode(e Elem) {
+	switch x := e.(type) {
+	case *Struct:
+		p.genDecodeStruct(x)
+	case *Array:
+		szVar := randIdent()
+		cborPrintf(p, "\tvar %s uint64\n", szVar)
+		cborPrintf(p, "\t%s, b, err = cbor.ReadArrayHeaderBytes(b)\n", szVar)
+		cborPrintf(p, "\tif err != nil {\n\t\treturn nil, err\n\t}\n")
+		cborPrintf(p, "\tif %s != uint64(%s) {\n\t\treturn nil, errors.New(\"msgp: cbor: array size mismatch\")\n\t}\n", szVar, x.Size)
+		cborPrintf(p, "\tfor %s := range %s {\n", x.Index, x.Varname())
+		p.genDecode(x.Els)
+		cborPrintf(p, "\t}\n")
+	case *Slice:
+		p.genDecodeSlice(x)
+	case *Map:
+		p.genDecodeMap(x)
+	case *Ptr:
+		p.genDecode(x.Value)
+	case *BaseElem:
+		p.genDecodeBase(x)
+	}
+}
+
+func (p *cborPrinter) genDecodeSlice(x *Slice) {
+	decode := func() {
+		if kind := x.FastpathKind(); kind != "" {
+			cborPrintf(p, "\t%s, b, err = %s(b)\n", x.Varname(), fastpathDecFunc(kind))
+			cborPrintf(p, "\tif err != nil {\n\t\treturn nil, err\n\t}\n")
+			return
+		}
+		szVar := randIdent()
+		cborPrintf(p, "\tvar %s uint64\n", szVar)
+		cborPrintf(p, "\t%s, b, err = cbor.ReadArrayHeaderBytes(b)\n", szVar)
+		cborPrintf(p, "\tif err != nil {\n\t\treturn nil, err\n\t}\n")
+		cborPrintf(p, "\t%s = make(%s, %s)\n", x.Varname(), x.TypeName(), szVar)
+		cborPrintf(p, "\tfor %s := range %s {\n", x.Index, x.Varname())
+		p.genDecode(x.Els)
+		cborPrintf(p, "\t}\n")
+	}
+	if !x.isAllowNil {
+		decode()
+		return
+	}
+	cborPrintf(p, "\tif len(b) > 0 && b[0] == 0xf6 {\n\t\t%s = nil\n\t\tb = b[1:]\n\t} else {\n", x.Varname())
+	decode()
+	cborPrintf(p, "\t}\n")
+}
+
+func (p *cborPrinter) genDecodeMap(x *Map) {
+	decode := func() {
+		if kind := x.FastpathKind(); kind != "" {
+			cborPrintf(p, "\t%s, b, err = %s(b)\n", x.Varname(), fastpathDecFunc(kind))
+			cborPrintf(p, "\tif err != nil {\n\t\treturn nil, err\n\t}\n")
+			return
+		}
+		szVar := randIdent()
+		cborPrintf(p, "\tvar %s uint64\n", szVar)
+		cborPrintf(p, "\t%s, b, err = cbor.ReadMapHeaderBytes(b)\n", szVar)
+		cborPrintf(p, "\tif err != nil {\n\t\treturn nil, err\n\t}\n")
+		cborPrintf(p, "\t%s = make(%s, %s)\n", x.Varname(), x.TypeName(), szVar)
+		cnt := randIdent()
+		cborPrintf(p, "\tfor %s := uint64(0); %s < %s; %s++ {\n", cnt, cnt, szVar, cnt)
+		cborPrintf(p, "\t\tvar %s string\n", x.Keyidx)
+		cborPrintf(p, "\t\t%s, b, err = cbor.ReadStringBytes(b)\n", x.Keyidx)
+		cborPrintf(p, "\t\tif err != nil {\n\t\t\treturn nil, err\n\t\t}\n")
+		cborPrintf(p, "\t\tvar %s %s\n", x.Validx, x.Value.TypeName())
+		p.genDecode(x.Value)
+		cborPrintf(p, "\t\t%s[%s] = %s\n", x.Varname(), x.Keyidx, x.Validx)
+		cborPrintf(p, "\t}\n")
+	}
+	if !x.isAllowNil {
+		decode()
+		return
+	}
+	cborPrintf(p, "\tif len(b) > 0 && b[0] == 0xf6 {\n\t\t%s = nil\n\t\tb = b[1:]\n\t} else {\n", x.Varname())
+	decode()
+	cborPrintf(p, "\t}\n")
+}
+
+func (p *cborPrinter) genDecodeStruct(s *Struct) {
+	fields := declaredFields(s)
+	extra := s.Extra()
+	if err := validateCBORKeys(fields); err != nil {
+		if p.err == nil {
+			p.err = err
+		}
+		return
+	}
+	if err := s.ValidateExtra(); err != nil {
+		if p.err == nil {
+			p.err = err
+		}
+		return
+	}
+	if s.AsTuple {
+		szVar := randIdent()
+		cborPrintf(p, "\tvar %s uint64\n", szVar)
+		cborPrintf(p, "\t%s, b, err = cbor.ReadArrayHeaderBytes(b)\n", szVar)
+		cborPrintf(p, "\tif err != nil {\n\t\treturn nil, err\n\t}\n")
+		cborPrintf(p, "\tif %s != %d {\n\t\treturn nil, errors.New(\"msgp: cbor: array size mismatch\")\n\t}\n", szVar, len(fields))
+		for i := range fields {
+			p.genDecode(fields[i].FieldElem)
+		}
+		return
+	}
+
+	keyed := anyCBORKeyed(fields)
+	extraIsMap := false
+	if extra != nil {
+		_, extraIsMap = extra.FieldElem.(*Map)
+	}
+	szVar, idxVar, keyVar := randIdent(), randIdent(), randIdent()
+	if extra != nil && extraIsMap {
+		cborPrintf(p, "\t%s = make(%s)\n", extra.FieldElem.Varname(), extra.FieldElem.TypeName())
+	}
+	cborPrintf(p, "\tvar %s uint64\n", szVar)
+	cborPrintf(p, "\t%s, b, err = cbor.ReadMapHeaderBytes(b)\n", szVar)
+	cborPrintf(p, "\tif err != nil {\n\t\treturn nil, err\n\t}\n")
+	cborPrintf(p, "\tfor %s := uint64(0); %s < %s; %s++ {\n", idxVar, idxVar, szVar, idxVar)
+	var entryVar string
+	if extra != nil && !extraIsMap {
+		// A bare msgp.Raw catch-all needs the original key+value bytes
+		// preserved verbatim, so snapshot b before the key is even read.
+		entryVar = randIdent()
+		cborPrintf(p, "\t\t%s := b\n", entryVar)
+	}
+	if keyed {
+		cborPrintf(p, "\t\tvar %s uint64\n", keyVar)
+		cborPrintf(p, "\t\t%s, b, err = cbor.ReadUintBytes(b)\n", keyVar)
+	} else {
+		cborPrintf(p, "\t\tvar %s string\n", keyVar)
+		cborPrintf(p, "\t\t%s, b, err = cbor.ReadStringBytes(b)\n", keyVar)
+	}
+	cborPrintf(p, "\t\tif err != nil {\n\t\t\treturn nil, err\n\t\t}\n")
+	cborPrintf(p, "\t\tswitch %s {\n", keyVar)
+	for i := range fields {
+		f := fields[i]
+		if keyed {
+			key, ok := f.CBORKey()
+			if !ok {
+				continue
+			}
+			cborPrintf(p, "\t\tcase %d:\n", key)
+		} else {
+			cborPrintf(p, "\t\tcase %q:\n", f.FieldTag)
+		}
+		p.genDecode(f.FieldElem)
+	}
+	cborPrintf(p, "\t\tdefault:\n")
+	if extra != nil && extraIsMap {
+		rawVar := randIdent()
+		cborPrintf(p, "\t\t\t%s := b\n", rawVar)
+		cborPrintf(p, "\t\t\tb, err = cbor.Skip(b)\n")
+		cborPrintf(p, "\t\t\tif err != nil {\n\t\t\t\treturn nil, err\n\t\t\t}\n")
+		if keyed {
+			cborPrintf(p, "\t\t\t%s[strconv.FormatUint(%s, 10)] = append([]byte(nil), %s[:len(%s)-len(b)]...)\n", extra.FieldElem.Varname(), keyVar, rawVar, rawVar)
+		} else {
+			cborPrintf(p, "\t\t\t%s[%s] = append([]byte(nil), %s[:len(%s)-len(b)]...)\n", extra.FieldElem.Varname(), keyVar, rawVar, rawVar)
+		}
+	} else if extra != nil {
+		cborPrintf(p, "\t\t\tb, err = cbor.Skip(b)\n")
+		cborPrintf(p, "\t\t\tif err != nil {\n\t\t\t\treturn nil, err\n\t\t\t}\n")
+		cborPrintf(p, "\t\t\t%s = append(%s, %s[:len(%s)-len(b)]...)\n", extra.FieldElem.Varname(), extra.FieldElem.Varname(), entryVar, entryVar)
+	} else {
+		cborPrintf(p, "\t\t\tb, err = cbor.Skip(b)\n")
+		cborPrintf(p, "\t\t\tif err != nil {\n\t\t\t\treturn nil, err\n\t\t\t}\n")
+	}
+	cborPrintf(p, "\t\t}\n")
+	cborPrintf(p, "\t}\n")
+}
+
+// anyCBORKeyed reports whether any field declares a `cbor:key=N` tag. When
+// true, the whole struct is decoded with integer map keys, which matches
+// the feature's intended use: a compact, all-integer-keyed schema. See
+// validateCBORKeys for the rule that every field must then have one.
+func anyCBORKeyed(fields []StructField) bool {
+	for i := range fields {
+		if _, ok := fields[i].CBORKey(); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// validateCBORKeys enforces that `cbor:key` is all-or-nothing within a
+// struct. genDecodeStruct switches the entire key encoding to integers
+// once anyCBORKeyed is true, but genEncodeStruct still writes a string key
+// for any field lacking its own `cbor:key`; a struct that mixes tagged and
+// untagged fields would produce a decoder that can't read its own output.
+func validateCBORKeys(fields []StructField) error {
+	if !anyCBORKeyed(fields) {
+		return nil
+	}
+	seen := make(map[uint64]string, len(fields))
+	for i := range fields {
+		key, ok := fields[i].CBORKey()
+		if !ok {
+			return fmt.Errorf("msgp: cbor: field %q has no cbor:key tag, but another field in the same struct does; cbor:key must be set on every field or none", fields[i].FieldName)
+		}
+		if other, dup := seen[key]; dup {
+			return fmt.Errorf("msgp: cbor: fields %q and %q both use cbor:key=%d; keys must be unique within a struct", other, fields[i].FieldName, key)
+		}
+		seen[key] = fields[i].FieldName
+	}
+	return nil
+}
+
+func (p *cborPrinter) genDecodeBase(b *BaseElem) {
+	dst := b.Varname()
+	switch b.Value {
+	case Time:
+		tagVar, secVar := randIdent(), randIdent()
+		cborPrintf(p, "\tvar %s uint64\n", tagVar)
+		cborPrintf(p, "\t%s, b, err = cbor.ReadTagBytes(b)\n", tagVar)
+		cborPrintf(p, "\tif err != nil {\n\t\treturn nil, err\n\t}\n")
+		cborPrintf(p, "\tif %s != %d {\n\t\treturn nil, fmt.Errorf(\"msgp: cbor: unexpected tag %%d for time.Time\", %s)\n\t}\n", tagVar, cborTagTime, tagVar)
+		cborPrintf(p, "\tvar %s int64\n", secVar)
+		cborPrintf(p, "\t%s, b, err = cbor.ReadIntBytes(b)\n", secVar)
+		cborPrintf(p, "\tif err != nil {\n\t\treturn nil, err\n\t}\n")
+		if b.Convert {
+			cborPrintf(p, "\t%s = %s(time.Unix(%s, 0))\n", dst, b.FromBase(), secVar)
+		} else {
+			cborPrintf(p, "\t%s = time.Unix(%s, 0)\n", dst, secVar)
+		}
+	case JsonNumber:
+		tagVar, strVar := randIdent(), randIdent()
+		cborPrintf(p, "\tvar %s uint64\n", tagVar)
+		cborPrintf(p, "\t%s, b, err = cbor.ReadTagBytes(b)\n", tagVar)
+		cborPrintf(p, "\tif err != nil {\n\t\treturn nil, err\n\t}\n")
+		cborPrintf(p, "\tif %s != %d {\n\t\treturn nil, fmt.Errorf(\"msgp: cbor: unexpected tag %%d for json.Number\", %s)\n\t}\n", tagVar, cborTagDecimal, tagVar)
+		cborPrintf(p, "\tvar %s string\n", strVar)
+		cborPrintf(p, "\t%s, b, err = cbor.ReadStringBytes(b)\n", strVar)
+		cborPrintf(p, "\tif err != nil {\n\t\treturn nil, err\n\t}\n")
+		if b.Convert {
+			cborPrintf(p, "\t%s = %s(json.Number(%s))\n", dst, b.FromBase(), strVar)
+		} else {
+			cborPrintf(p, "\t%s = json.Number(%s)\n", dst, strVar)
+		}
+	case String:
+		p.genDecodeSimple(b, "cbor.ReadStringBytes(b)")
+	case Bytes:
+		tmp := randIdent()
+		cborPrintf(p, "\tvar %s []byte\n", tmp)
+		cborPrintf(p, "\t%s, b, err = cbor.ReadBytesBytes(b, %s)\n", tmp, tmp)
+		cborPrintf(p, "\tif err != nil {\n\t\treturn nil, err\n\t}\n")
+		if b.Convert {
+			cborPrintf(p, "\t%s = %s(%s)\n", dst, b.FromBase(), tmp)
+		} else {
+			cborPrintf(p, "\t%s = %s\n", dst, tmp)
+		}
+	case Bool:
+		p.genDecodeSimple(b, "cbor.ReadBoolBytes(b)")
+	case Float32:
+		tmp := randIdent()
+		cborPrintf(p, "\tvar %s float64\n", tmp)
+		cborPrintf(p, "\t%s, b, err = cbor.ReadFloat64Bytes(b)\n", tmp)
+		cborPrintf(p, "\tif err != nil {\n\t\treturn nil, err\n\t}\n")
+		if b.Convert {
+			cborPrintf(p, "\t%s = %s(float32(%s))\n", dst, b.FromBase(), tmp)
+		} else {
+			cborPrintf(p, "\t%s = float32(%s)\n", dst, tmp)
+		}
+	case Float64:
+		p.genDecodeSimple(b, "cbor.ReadFloat64Bytes(b)")
+	case BigInt, BigFloat, Decimal:
+		extType, _ := bignumExtType(b.Value)
+		tagVar := randIdent()
+		cborPrintf(p, "\tvar %s uint64\n", tagVar)
+		cborPrintf(p, "\t%s, b, err = cbor.ReadTagBytes(b)\n", tagVar)
+		cborPrintf(p, "\tif err != nil {\n\t\treturn nil, err\n\t}\n")
+		cborPrintf(p, "\tif %s != %d {\n\t\treturn nil, fmt.Errorf(\"msgp: cbor: unexpected ext tag %%d for %s\", %s)\n\t}\n", tagVar, extType, b.BaseName(), tagVar)
+		p.genDecodeBignumPayload(b, dst)
+	case Complex64, Complex128:
+		szVar, reVar, imVar := randIdent(), randIdent(), randIdent()
+		cborPrintf(p, "\tvar %s uint64\n", szVar)
+		cborPrintf(p, "\t%s, b, err = cbor.ReadArrayHeaderBytes(b)\n", szVar)
+		cborPrintf(p, "\tif err != nil {\n\t\treturn nil, err\n\t}\n")
+		cborPrintf(p, "\tif %s != 2 {\n\t\treturn nil, errors.New(\"msgp: cbor: complex number array size mismatch\")\n\t}\n", szVar)
+		cborPrintf(p, "\tvar %s, %s float64\n", reVar, imVar)
+		cborPrintf(p, "\t%s, b, err = cbor.ReadFloat64Bytes(b)\n", reVar)
+		cborPrintf(p, "\tif err != nil {\n\t\treturn nil, err\n\t}\n")
+		cborPrintf(p, "\t%s, b, err = cbor.ReadFloat64Bytes(b)\n", imVar)
+		cborPrintf(p, "\tif err != nil {\n\t\treturn nil, err\n\t}\n")
+		castType := "complex64"
+		if b.Value == Complex128 {
+			castType = "complex128"
+		}
+		if b.Convert {
+			cborPrintf(p, "\t%s = %s(%s(complex(%s, %s)))\n", dst, b.FromBase(), castType, reVar, imVar)
+		} else {
+			cborPrintf(p, "\t%s = %s(complex(%s, %s))\n", dst, castType, reVar, imVar)
+		}
+	case Intf, Ext:
+		if p.err == nil {
+			p.err = fmt.Errorf("msgp: cbor: field %q has no CBOR decoding for kind %s", dst, b.BaseName())
+		}
+	default:
+		p.genDecodeDefaultBase(b)
+	}
+}
+
+// genDecodeDefaultBase handles every integer Primitive kind without its own
+// genDecodeBase case (see cborSignedIntPrimitives/cborUnsignedIntPrimitives):
+// it reads the correctly-signed 64-bit wire value, then casts it down to
+// dst's actual declared type (or through the field's shim, same as
+// genDecodeSimple), since a bare assignment from int64/uint64 only compiles
+// when dst's type happens to be exactly that.
+func (p *cborPrinter) genDecodeDefaultBase(b *BaseElem) {
+	dst := b.Varname()
+	tmp := randIdent()
+	switch {
+	case cborUnsignedIntPrimitives[b.Value]:
+		cborPrintf(p, "\tvar %s uint64\n", tmp)
+		cborPrintf(p, "\t%s, b, err = cbor.ReadUintBytes(b)\n", tmp)
+	case cborSignedIntPrimitives[b.Value]:
+		cborPrintf(p, "\tvar %s int64\n", tmp)
+		cborPrintf(p, "\t%s, b, err = cbor.ReadIntBytes(b)\n", tmp)
+	default:
+		if p.err == nil {
+			p.err = fmt.Errorf("msgp: cbor: field %q has no CBOR decoding for kind %s", dst, b.BaseName())
+		}
+		return
+	}
+	cborPrintf(p, "\tif err != nil {\n\t\treturn nil, err\n\t}\n")
+	if b.Convert {
+		cborPrintf(p, "\t%s = %s(%s)\n", dst, b.FromBase(), tmp)
+	} else {
+		cborPrintf(p, "\t%s = %s(%s)\n", dst, b.BaseType(), tmp)
+	}
+}
+
+// genDecodeSimple emits "dst, b, err = call" (or a shim tmp var when
+// b.Convert is set) plus the shared error check.
+func (p *cborPrinter) genDecodeSimple(b *BaseElem, call string) {
+	dst := b.Varname()
+	if !b.Convert {
+		cborPrintf(p, "\t%s, b, err = %s\n", dst, call)
+		cborPrintf(p, "\tif err != nil {\n\t\treturn nil, err\n\t}\n")
+		return
+	}
+	tmp := randIdent()
+	cborPrintf(p, "\tvar %s %s\n", tmp, b.ToBase())
+	cborPrintf(p, "\t%s, b, err = %s\n", tmp, call)
+	cborPrintf(p, "\tif err != nil {\n\t\treturn nil, err\n\t}\n")
+	cborPrintf(p, "\t%s = %s(%s)\n", dst, b.FromBase(), tmp)
+}
+
+// genDecodeBignumPayload is the decode counterpart of
+// genEncodeBignumPayload: it reads the CBOR byte string following the ext
+// tag the caller already validated and GobDecodes it into dst, applying
+// b's shim (Convert/FromBase) the same way genDecodeSimple does.
+func (p *cborPrinter) genDecodeBignumPayload(b *BaseElem, dst string) {
+	tmp := randIdent()
+	cborPrintf(p, "\tvar %s []byte\n", tmp)
+	cborPrintf(p, "\t%s, b, err = cbor.ReadBytesBytes(b, %s)\n", tmp, tmp)
+	cborPrintf(p, "\tif err != nil {\n\t\treturn nil, err\n\t}\n")
+	if !b.Convert {
+		cborPrintf(p, "\tif err = %s.GobDecode(%s); err != nil {\n\t\treturn nil, err\n\t}\n", dst, tmp)
+		return
+	}
+	baseTmp := randIdent()
+	cborPrintf(p, "\tvar %s %s\n", baseTmp, b.ToBase())
+	cborPrintf(p, "\tif err = %s.GobDecode(%s); err != nil {\n\t\treturn nil, err\n\t}\n", baseTmp, tmp)
+	cborPrintf(p, "\t%s = %s(%s)\n", dst, b.FromBase(), baseTmp)
+}
@@ -0,0 +1,560 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"strings"
+	"testing"
+)
+
+func cborTestStruct() *Struct {
+	s := &Struct{
+		Fields: []StructField{
+			{FieldTag: "name", FieldName: "Name", FieldElem: &BaseElem{Value: String}},
+			{FieldTag: "count", FieldTagParts: []string{"count", "omitempty"}, FieldName: "Count", FieldElem: &BaseElem{Value: Int}},
+		},
+	}
+	s.Alias("Thing")
+	ptr := &Ptr{Value: s}
+	ptr.SetVarname("z")
+	return s
+}
+
+func TestWriteCBORMethodsDisabledByDefault(t *testing.T) {
+	CBOREnabled = false
+	var buf bytes.Buffer
+	if err := WriteCBORMethods(&buf, cborTestStruct()); err != nil {
+		t.Fatalf("WriteCBORMethods: %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("expected no output when CBOREnabled is false, got %q", buf.String())
+	}
+}
+
+func TestWriteCBORMethodsEnabled(t *testing.T) {
+	Options{CBOR: true}.Apply()
+	defer func() { CBOREnabled = false }()
+
+	var buf bytes.Buffer
+	if err := WriteCBORMethods(&buf, cborTestStruct()); err != nil {
+		t.Fatalf("WriteCBORMethods: %v", err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "MarshalCBOR") || !strings.Contains(out, "UnmarshalCBOR") {
+		t.Fatalf("expected both methods in output:\n%s", out)
+	}
+	if !strings.Contains(out, "cbor.AppendMapHeader") {
+		t.Fatalf("expected map header write for non-tuple struct:\n%s", out)
+	}
+	if _, err := format.Source([]byte(out)); err != nil {
+		t.Fatalf("generated CBOR methods are not valid Go source: %v\n%s", err, out)
+	}
+}
+
+func extraTestStruct() *Struct {
+	s := &Struct{
+		Fields: []StructField{
+			{FieldTag: "name", FieldName: "Name", FieldElem: &BaseElem{Value: String}},
+			{FieldTagParts: []string{"", "extra"}, FieldName: "Extra", FieldElem: &Map{Value: &BaseElem{Value: Bytes}}},
+		},
+	}
+	s.Alias("Thing")
+	ptr := &Ptr{Value: s}
+	ptr.SetVarname("z")
+	return s
+}
+
+func TestCBORPrinterRoundTripsExtraField(t *testing.T) {
+	s := extraTestStruct()
+
+	CBOREnabled = true
+	defer func() { CBOREnabled = false }()
+	var buf bytes.Buffer
+	if err := WriteCBORMethods(&buf, s); err != nil {
+		t.Fatalf("WriteCBORMethods: %v", err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "z.Extra") {
+		t.Fatalf("expected the `,extra` catch-all field to be referenced by the CBOR printer:\n%s", out)
+	}
+	if !strings.Contains(out, "uint64(1)") {
+		t.Fatalf("expected the map header count to start from the declared field count:\n%s", out)
+	}
+	if !strings.Contains(out, "+= uint64(len(z.Extra))") {
+		t.Fatalf("expected the map header count to grow by the number of extra entries:\n%s", out)
+	}
+	if !strings.Contains(out, "range z.Extra") {
+		t.Fatalf("expected the extra entries to be written back out on encode:\n%s", out)
+	}
+	if !strings.Contains(out, "z.Extra = make(map[string][]byte)") {
+		t.Fatalf("expected the extra map to be allocated before decode:\n%s", out)
+	}
+	if !strings.Contains(out, "cbor.Skip(b)") {
+		t.Fatalf("expected unknown keys to still go through cbor.Skip to find their length:\n%s", out)
+	}
+	if _, err := format.Source([]byte(out)); err != nil {
+		t.Fatalf("generated CBOR methods are not valid Go source: %v\n%s", err, out)
+	}
+}
+
+func rawBaseElem() *BaseElem {
+	be := &BaseElem{Value: IDENT}
+	be.Alias("msgp.Raw")
+	return be
+}
+
+func TestCBORPrinterRoundTripsMsgpRawMapExtraField(t *testing.T) {
+	s := &Struct{
+		Fields: []StructField{
+			{FieldTag: "name", FieldName: "Name", FieldElem: &BaseElem{Value: String}},
+			{FieldTagParts: []string{"", "extra"}, FieldName: "Extra", FieldElem: &Map{Value: rawBaseElem()}},
+		},
+	}
+	s.Alias("Thing")
+	ptr := &Ptr{Value: s}
+	ptr.SetVarname("z")
+
+	CBOREnabled = true
+	defer func() { CBOREnabled = false }()
+	var buf bytes.Buffer
+	if err := WriteCBORMethods(&buf, s); err != nil {
+		t.Fatalf("WriteCBORMethods: %v", err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "z.Extra = make(map[string]msgp.Raw)") {
+		t.Fatalf("expected the map[string]msgp.Raw extra map to be allocated before decode:\n%s", out)
+	}
+	if _, err := format.Source([]byte(out)); err != nil {
+		t.Fatalf("generated CBOR methods are not valid Go source: %v\n%s", err, out)
+	}
+}
+
+func TestCBORPrinterRoundTripsBareMsgpRawExtraField(t *testing.T) {
+	s := &Struct{
+		Fields: []StructField{
+			{FieldTag: "name", FieldName: "Name", FieldElem: &BaseElem{Value: String}},
+			{FieldTagParts: []string{"", "extra"}, FieldName: "Extra", FieldElem: rawBaseElem()},
+		},
+	}
+	s.Alias("Thing")
+	ptr := &Ptr{Value: s}
+	ptr.SetVarname("z")
+
+	CBOREnabled = true
+	defer func() { CBOREnabled = false }()
+	var buf bytes.Buffer
+	if err := WriteCBORMethods(&buf, s); err != nil {
+		t.Fatalf("WriteCBORMethods: %v", err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "z.Extra = append(z.Extra,") {
+		t.Fatalf("expected unmatched keys to be appended verbatim into the bare msgp.Raw catch-all:\n%s", out)
+	}
+	if !strings.Contains(out, "b = append(b, z.Extra...)") {
+		t.Fatalf("expected the bare msgp.Raw catch-all to be appended verbatim on encode:\n%s", out)
+	}
+	if _, err := format.Source([]byte(out)); err != nil {
+		t.Fatalf("generated CBOR methods are not valid Go source: %v\n%s", err, out)
+	}
+}
+
+func TestValidateExtraAcceptsMsgpRawForms(t *testing.T) {
+	mapForm := &Struct{
+		Fields: []StructField{
+			{FieldTagParts: []string{"", "extra"}, FieldName: "Extra", FieldElem: &Map{Value: rawBaseElem()}},
+		},
+	}
+	mapForm.Alias("Thing")
+	if err := mapForm.ValidateExtra(); err != nil {
+		t.Fatalf("expected map[string]msgp.Raw to be accepted: %v", err)
+	}
+
+	bareForm := &Struct{
+		Fields: []StructField{
+			{FieldTagParts: []string{"", "extra"}, FieldName: "Extra", FieldElem: rawBaseElem()},
+		},
+	}
+	bareForm.Alias("Thing")
+	if err := bareForm.ValidateExtra(); err != nil {
+		t.Fatalf("expected a bare msgp.Raw field to be accepted: %v", err)
+	}
+}
+
+func TestValidateExtraRejectsMultipleExtraFields(t *testing.T) {
+	s := &Struct{
+		Fields: []StructField{
+			{FieldTagParts: []string{"", "extra"}, FieldName: "ExtraA", FieldElem: &Map{Value: &BaseElem{Value: Bytes}}},
+			{FieldTagParts: []string{"", "extra"}, FieldName: "ExtraB", FieldElem: &Map{Value: &BaseElem{Value: Bytes}}},
+		},
+	}
+	s.Alias("Thing")
+	if err := s.ValidateExtra(); err == nil {
+		t.Fatal("expected an error for a struct with more than one `,extra` field")
+	}
+}
+
+func TestValidateExtraRejectsAsTuple(t *testing.T) {
+	s := &Struct{
+		AsTuple: true,
+		Fields: []StructField{
+			{FieldTagParts: []string{"", "extra"}, FieldName: "Extra", FieldElem: &Map{Value: &BaseElem{Value: Bytes}}},
+		},
+	}
+	s.Alias("Thing")
+	if err := s.ValidateExtra(); err == nil {
+		t.Fatal("expected an error for an AsTuple struct with an `,extra` field")
+	}
+}
+
+func TestCBORPrinterRejectsAsTupleWithExtra(t *testing.T) {
+	s := &Struct{
+		AsTuple: true,
+		Fields: []StructField{
+			{FieldTag: "name", FieldName: "Name", FieldElem: &BaseElem{Value: String}},
+			{FieldTagParts: []string{"", "extra"}, FieldName: "Extra", FieldElem: &Map{Value: &BaseElem{Value: Bytes}}},
+		},
+	}
+	s.Alias("Thing")
+	ptr := &Ptr{Value: s}
+	ptr.SetVarname("z")
+
+	CBOREnabled = true
+	defer func() { CBOREnabled = false }()
+	var buf bytes.Buffer
+	if err := WriteCBORMethods(&buf, s); err == nil {
+		t.Fatal("expected WriteCBORMethods to reject an AsTuple struct with a `,extra` field instead of silently dropping it")
+	}
+}
+
+func TestValidateExtraRejectsNonByteMap(t *testing.T) {
+	s := &Struct{
+		Fields: []StructField{
+			{FieldTagParts: []string{"", "extra"}, FieldName: "Extra", FieldElem: &Map{Value: &BaseElem{Value: String}}},
+		},
+	}
+	s.Alias("Thing")
+	if err := s.ValidateExtra(); err == nil {
+		t.Fatal("expected an error for an `,extra` field that isn't a map[string][]byte")
+	}
+}
+
+func TestCBORPrinterRejectsInvalidExtraField(t *testing.T) {
+	s := &Struct{
+		Fields: []StructField{
+			{FieldTag: "name", FieldName: "Name", FieldElem: &BaseElem{Value: String}},
+			{FieldTagParts: []string{"", "extra"}, FieldName: "Extra", FieldElem: &Map{Value: &BaseElem{Value: String}}},
+		},
+	}
+	s.Alias("Thing")
+	ptr := &Ptr{Value: s}
+	ptr.SetVarname("z")
+
+	CBOREnabled = true
+	defer func() { CBOREnabled = false }()
+	var buf bytes.Buffer
+	if err := WriteCBORMethods(&buf, s); err == nil {
+		t.Fatalf("expected an error for an `,extra` field that isn't a map[string][]byte, got output:\n%s", buf.String())
+	}
+}
+
+func TestCBORPrinterWritesBignumPayload(t *testing.T) {
+	s := &Struct{
+		Fields: []StructField{
+			{FieldTag: "amount", FieldName: "Amount", FieldElem: &BaseElem{Value: BigInt}},
+		},
+	}
+	s.Alias("Thing")
+	ptr := &Ptr{Value: s}
+	ptr.SetVarname("z")
+
+	CBOREnabled = true
+	defer func() { CBOREnabled = false }()
+	var buf bytes.Buffer
+	if err := WriteCBORMethods(&buf, s); err != nil {
+		t.Fatalf("WriteCBORMethods: %v", err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "z.Amount.GobEncode()") {
+		t.Fatalf("expected the BigInt payload to be written via GobEncode:\n%s", out)
+	}
+	if !strings.Contains(out, "z.Amount.GobDecode(") {
+		t.Fatalf("expected the BigInt payload to be read via GobDecode:\n%s", out)
+	}
+	if !strings.Contains(out, "cbor.AppendBytes") || !strings.Contains(out, "cbor.ReadBytesBytes") {
+		t.Fatalf("expected the payload bytes to round-trip through AppendBytes/ReadBytesBytes:\n%s", out)
+	}
+	if _, err := format.Source([]byte(out)); err != nil {
+		t.Fatalf("generated CBOR methods are not valid Go source: %v\n%s", err, out)
+	}
+}
+
+func TestCBORPrinterValidatesTimeTag(t *testing.T) {
+	s := &Struct{
+		Fields: []StructField{
+			{FieldTag: "at", FieldName: "At", FieldElem: &BaseElem{Value: Time}},
+		},
+	}
+	s.Alias("Thing")
+	ptr := &Ptr{Value: s}
+	ptr.SetVarname("z")
+
+	CBOREnabled = true
+	defer func() { CBOREnabled = false }()
+	var buf bytes.Buffer
+	if err := WriteCBORMethods(&buf, s); err != nil {
+		t.Fatalf("WriteCBORMethods: %v", err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, fmt.Sprintf("!= %d", cborTagTime)) {
+		t.Fatalf("expected the decoded tag to be checked against cborTagTime:\n%s", out)
+	}
+	if _, err := format.Source([]byte(out)); err != nil {
+		t.Fatalf("generated CBOR methods are not valid Go source (likely an unused tag variable): %v\n%s", err, out)
+	}
+}
+
+func TestFastpathHelpersWired(t *testing.T) {
+	s := &Struct{
+		Fields: []StructField{
+			{FieldTag: "tags", FieldName: "Tags", FieldElem: &Slice{Els: &BaseElem{Value: String}}},
+		},
+	}
+	s.Alias("Thing")
+	ptr := &Ptr{Value: s}
+	ptr.SetVarname("z")
+
+	Options{CBOR: true, Fastpath: true}.Apply()
+	defer func() { CBOREnabled = false; FastpathEnabled = false }()
+	ResetFastpathUsage()
+
+	var buf bytes.Buffer
+	if err := WriteCBORMethods(&buf, s); err != nil {
+		t.Fatalf("WriteCBORMethods: %v", err)
+	}
+	if err := WriteFastpathHelpers(&buf); err != nil {
+		t.Fatalf("WriteFastpathHelpers: %v", err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "encFastpath_SliceString(b, z.Tags)") {
+		t.Fatalf("expected the slice field to be written via the shared fastpath helper:\n%s", out)
+	}
+	if !strings.Contains(out, "decFastpath_SliceString(b)") {
+		t.Fatalf("expected the slice field to be read via the shared fastpath helper:\n%s", out)
+	}
+	if !strings.Contains(out, "func encFastpath_SliceString(b []byte, v []string) []byte") {
+		t.Fatalf("expected the fastpath helper pair to be emitted:\n%s", out)
+	}
+	if _, err := format.Source([]byte(out)); err != nil {
+		t.Fatalf("generated CBOR methods + fastpath helpers are not valid Go source: %v\n%s", err, out)
+	}
+}
+
+func TestFastpathHelpersNotEmittedWhenDisabled(t *testing.T) {
+	s := &Struct{
+		Fields: []StructField{
+			{FieldTag: "tags", FieldName: "Tags", FieldElem: &Slice{Els: &BaseElem{Value: String}}},
+		},
+	}
+	s.Alias("Thing")
+	ptr := &Ptr{Value: s}
+	ptr.SetVarname("z")
+
+	Options{CBOR: true, Fastpath: false}.Apply()
+	defer func() { CBOREnabled = false }()
+	ResetFastpathUsage()
+
+	var buf bytes.Buffer
+	if err := WriteCBORMethods(&buf, s); err != nil {
+		t.Fatalf("WriteCBORMethods: %v", err)
+	}
+	if err := WriteFastpathHelpers(&buf); err != nil {
+		t.Fatalf("WriteFastpathHelpers: %v", err)
+	}
+	out := buf.String()
+	if strings.Contains(out, "Fastpath") {
+		t.Fatalf("expected no fastpath helpers when Options.Fastpath is false:\n%s", out)
+	}
+}
+
+func TestCBORPrinterRejectsMixedCBORKeys(t *testing.T) {
+	s := &Struct{
+		Fields: []StructField{
+			{FieldTag: "a", FieldTagParts: []string{"a", "cbor:key=1"}, FieldName: "A", FieldElem: &BaseElem{Value: String}},
+			{FieldTag: "b", FieldName: "B", FieldElem: &BaseElem{Value: Int}},
+		},
+	}
+	s.Alias("Thing")
+	ptr := &Ptr{Value: s}
+	ptr.SetVarname("z")
+
+	CBOREnabled = true
+	defer func() { CBOREnabled = false }()
+	var buf bytes.Buffer
+	err := WriteCBORMethods(&buf, s)
+	if err == nil {
+		t.Fatalf("expected an error for a struct mixing cbor:key and untagged fields, got output:\n%s", buf.String())
+	}
+	if !strings.Contains(err.Error(), `"B"`) {
+		t.Fatalf("expected the error to name the untagged field, got: %v", err)
+	}
+}
+
+func TestCBORPrinterRejectsDuplicateCBORKeys(t *testing.T) {
+	s := &Struct{
+		Fields: []StructField{
+			{FieldTag: "a", FieldTagParts: []string{"a", "cbor:key=1"}, FieldName: "A", FieldElem: &BaseElem{Value: String}},
+			{FieldTag: "b", FieldTagParts: []string{"b", "cbor:key=1"}, FieldName: "B", FieldElem: &BaseElem{Value: String}},
+		},
+	}
+	s.Alias("Thing")
+	ptr := &Ptr{Value: s}
+	ptr.SetVarname("z")
+
+	CBOREnabled = true
+	defer func() { CBOREnabled = false }()
+	var buf bytes.Buffer
+	err := WriteCBORMethods(&buf, s)
+	if err == nil {
+		t.Fatalf("expected an error for a struct with two fields sharing cbor:key=1, got output:\n%s", buf.String())
+	}
+	if !strings.Contains(err.Error(), `"A"`) || !strings.Contains(err.Error(), `"B"`) {
+		t.Fatalf("expected the error to name both colliding fields, got: %v", err)
+	}
+}
+
+func TestAnyCBORKeyed(t *testing.T) {
+	fields := []StructField{
+		{FieldTag: "a", FieldTagParts: []string{"a", "cbor:key=1"}, FieldElem: &BaseElem{Value: String}},
+		{FieldTag: "b", FieldElem: &BaseElem{Value: Int}},
+	}
+	if !anyCBORKeyed(fields) {
+		t.Fatal("expected anyCBORKeyed to be true when any field has a cbor:key tag")
+	}
+	if anyCBORKeyed(fields[1:]) {
+		t.Fatal("expected anyCBORKeyed to be false when no field has a cbor:key tag")
+	}
+}
+
+func TestCBORPrinterRoundTripsComplex(t *testing.T) {
+	s := &Struct{
+		Fields: []StructField{
+			{FieldTag: "c64", FieldName: "C64", FieldElem: &BaseElem{Value: Complex64}},
+			{FieldTag: "c128", FieldName: "C128", FieldElem: &BaseElem{Value: Complex128}},
+		},
+	}
+	s.Alias("Thing")
+	ptr := &Ptr{Value: s}
+	ptr.SetVarname("z")
+
+	CBOREnabled = true
+	defer func() { CBOREnabled = false }()
+	var buf bytes.Buffer
+	if err := WriteCBORMethods(&buf, s); err != nil {
+		t.Fatalf("WriteCBORMethods: %v", err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "cbor.AppendArrayHeader(b, 2)") {
+		t.Fatalf("expected complex fields to be written as a 2-element array:\n%s", out)
+	}
+	if !strings.Contains(out, "z.C64 = complex64(") || !strings.Contains(out, "z.C128 = complex128(") {
+		t.Fatalf("expected complex fields to be cast back to their declared width:\n%s", out)
+	}
+	if _, err := format.Source([]byte(out)); err != nil {
+		t.Fatalf("generated CBOR methods are not valid Go source: %v\n%s", err, out)
+	}
+}
+
+func TestCBORPrinterRejectsIntf(t *testing.T) {
+	s := &Struct{
+		Fields: []StructField{
+			{FieldTag: "v", FieldName: "V", FieldElem: &BaseElem{Value: Intf}},
+		},
+	}
+	s.Alias("Thing")
+	ptr := &Ptr{Value: s}
+	ptr.SetVarname("z")
+
+	CBOREnabled = true
+	defer func() { CBOREnabled = false }()
+	var buf bytes.Buffer
+	if err := WriteCBORMethods(&buf, s); err == nil {
+		t.Fatal("expected WriteCBORMethods to reject an interface{} field")
+	}
+}
+
+func TestCBORPrinterRejectsExt(t *testing.T) {
+	s := &Struct{
+		Fields: []StructField{
+			{FieldTag: "v", FieldName: "V", FieldElem: &BaseElem{Value: Ext}},
+		},
+	}
+	s.Alias("Thing")
+	ptr := &Ptr{Value: s}
+	ptr.SetVarname("z")
+
+	CBOREnabled = true
+	defer func() { CBOREnabled = false }()
+	var buf bytes.Buffer
+	if err := WriteCBORMethods(&buf, s); err == nil {
+		t.Fatal("expected WriteCBORMethods to reject an msgp.Extension field")
+	}
+}
+
+// TestCBORPrinterEncodesUnsignedAsUint guards against the default
+// genEncodeBase branch writing every non-dedicated integer kind as a CBOR
+// signed int: a uint64 field holding a value above math.MaxInt64 must still
+// be written via cbor.AppendUint, matching what fastpathElems[Uint64]
+// already does for the identical element type inside a slice/map.
+func TestCBORPrinterEncodesUnsignedAsUint(t *testing.T) {
+	s := &Struct{
+		Fields: []StructField{
+			{FieldTag: "big", FieldName: "Big", FieldElem: &BaseElem{Value: Uint64}},
+		},
+	}
+	s.Alias("Thing")
+	ptr := &Ptr{Value: s}
+	ptr.SetVarname("z")
+
+	CBOREnabled = true
+	defer func() { CBOREnabled = false }()
+	var buf bytes.Buffer
+	if err := WriteCBORMethods(&buf, s); err != nil {
+		t.Fatalf("WriteCBORMethods: %v", err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "b = cbor.AppendUint(b, uint64(z.Big))") {
+		t.Fatalf("expected the Big field to be written with cbor.AppendUint:\n%s", out)
+	}
+	if strings.Contains(out, "b = cbor.AppendInt(b, int64(z.Big))") {
+		t.Fatalf("Big field was written with cbor.AppendInt, which mangles values above math.MaxInt64:\n%s", out)
+	}
+	if _, err := format.Source([]byte(out)); err != nil {
+		t.Fatalf("generated CBOR methods are not valid Go source: %v\n%s", err, out)
+	}
+}
+
+// TestCBORPrinterCastsDefaultDecode guards against the default genDecodeBase
+// branch assigning a bare cbor.ReadIntBytes/ReadUintBytes result (int64 or
+// uint64) straight into a field whose declared type is some other integer
+// kind (here Count int), which does not compile: Go has no implicit
+// conversion between distinct defined integer types.
+func TestCBORPrinterCastsDefaultDecode(t *testing.T) {
+	Options{CBOR: true}.Apply()
+	defer func() { CBOREnabled = false }()
+
+	var buf bytes.Buffer
+	if err := WriteCBORMethods(&buf, cborTestStruct()); err != nil {
+		t.Fatalf("WriteCBORMethods: %v", err)
+	}
+	out := buf.String()
+	if strings.Contains(out, "z.Count, b, err = cbor.ReadIntBytes(b)") {
+		t.Fatalf("Count field decode assigns int64 straight into an int field:\n%s", out)
+	}
+	if !strings.Contains(out, "z.Count = int(") {
+		t.Fatalf("expected Count field decode to cast through int:\n%s", out)
+	}
+	if _, err := format.Source([]byte(out)); err != nil {
+		t.Fatalf("generated CBOR methods are not valid Go source: %v\n%s", err, out)
+	}
+}
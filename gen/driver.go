@@ -0,0 +1,34 @@
+package gen
+
+import "io"
+
+// CBOREnabled gates whether WriteCBORMethods emits the CBOR backend for a
+// type. Unlike the MessagePack backend (always generated), CBOR output is
+// opt-in via the generator's -cbor flag; see Options.Apply.
+var CBOREnabled bool
+
+// WriteCBORMethods writes the MarshalCBOR/UnmarshalCBOR method pair for e
+// to w. The generator's driver calls this for every top-level type
+// alongside the MessagePack printers whenever CBOREnabled is set.
+func WriteCBORMethods(w io.Writer, e Elem) error {
+	if !CBOREnabled {
+		return nil
+	}
+	if err := marshalCBOR(w, e); err != nil {
+		return err
+	}
+	return unmarshalCBOR(w, e)
+}
+
+// WriteFastpathHelpers writes the encFastpath_*/decFastpath_* helper pair
+// for every fastpath kind referenced by the file's types since the last
+// ResetFastpathUsage. The driver calls this once per output file, after
+// WriteCBORMethods has run for all of that file's types (so every call
+// site a helper might need has already been generated and tracked), and
+// calls ResetFastpathUsage before moving on to the next file.
+func WriteFastpathHelpers(w io.Writer) error {
+	if !CBOREnabled || !FastpathEnabled {
+		return nil
+	}
+	return EmitFastpathHelpers(w)
+}
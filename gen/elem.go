@@ -2,6 +2,7 @@ package gen
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 )
 
@@ -93,6 +94,9 @@ const (
 	Duration   // time.Duration
 	Ext        // extension
 	JsonNumber // json.Number
+	BigInt     // math/big.Int
+	BigFloat   // math/big.Float
+	Decimal    // pluggable arbitrary-precision decimal, see -decimal-type
 
 	IDENT // IDENT means an unrecognized identifier
 )
@@ -125,8 +129,24 @@ var primitives = map[string]Primitive{
 	"time.Duration":  Duration,
 	"msgp.Extension": Ext,
 	"json.Number":    JsonNumber,
+	"big.Int":        BigInt,
+	"big.Float":      BigFloat,
 }
 
+// decimalIdent is the identifier (as it appears in Go source, e.g.
+// "decimal.Decimal") that should resolve to the Decimal primitive. Unlike
+// the other primitives above, the decimal type is pluggable: it is
+// populated once per generator run by SetDecimalType, driven by the
+// -decimal-type=<import path> flag, so that downstream users can choose
+// their own arbitrary-precision decimal library without editing this
+// package.
+var decimalIdent string
+
+// SetDecimalType registers ident (e.g. "decimal.Decimal") as the identifier
+// that resolves to the Decimal primitive for the remainder of this
+// generator run.
+func SetDecimalType(ident string) { decimalIdent = ident }
+
 // types built into the library
 // that satisfy all of the
 // interfaces.
@@ -224,6 +244,9 @@ type Elem interface {
 // Ident returns the *BaseElem that corresponds
 // to the provided identity.
 func Ident(id string) *BaseElem {
+	if decimalIdent != "" && id == decimalIdent {
+		return &BaseElem{Value: Decimal}
+	}
 	p, ok := primitives[id]
 	if ok {
 		return &BaseElem{Value: p}
@@ -333,6 +356,18 @@ func (m *Map) AllowNil() bool { return true }
 // SetIsAllowNil sets whether the map is allowed to be nil.
 func (m *Map) SetIsAllowNil(b bool) { m.isAllowNil = b }
 
+// FastpathKind returns the name of the shared encFastpath_*/decFastpath_*
+// helper pair that can serialize this map, or "" if its value type isn't
+// on the fastpath whitelist (see fastpathMapKind in fastpath.go). Only
+// map[string]V is eligible, which matches every Map produced by the parser.
+func (m *Map) FastpathKind() string {
+	be, ok := m.Value.(*BaseElem)
+	if !ok || be.Convert {
+		return ""
+	}
+	return fastpathMapKind(be.Value)
+}
+
 type Slice struct {
 	common
 	Index      string
@@ -382,6 +417,17 @@ func (s *Slice) AllowNil() bool { return true }
 // SetIsAllowNil sets whether the slice is allowed to be nil.
 func (s *Slice) SetIsAllowNil(b bool) { s.isAllowNil = b }
 
+// FastpathKind returns the name of the shared encFastpath_*/decFastpath_*
+// helper pair that can serialize this slice, or "" if its element type
+// isn't on the fastpath whitelist (see fastpathSliceKind in fastpath.go).
+func (s *Slice) FastpathKind() string {
+	be, ok := s.Els.(*BaseElem)
+	if !ok || be.Convert {
+		return ""
+	}
+	return fastpathSliceKind(be.Value)
+}
+
 // SetIsAllowNil will set whether the element is allowed to be nil.
 func SetIsAllowNil(e Elem, b bool) {
 	type i interface {
@@ -538,6 +584,66 @@ func (s *Struct) CountFieldTagPart(pname string) int {
 	return n
 }
 
+// Extra returns the field tagged `msg:",extra"`, the catch-all used to
+// preserve fields the Go struct doesn't know about across a decode/encode
+// round-trip, or nil if the struct has none. Callers should use
+// ValidateExtra first; Extra itself does not enforce the "at most one,
+// never on AsTuple" rules.
+func (s *Struct) Extra() *StructField {
+	for i := range s.Fields {
+		if s.Fields[i].HasTagPart("extra") {
+			return &s.Fields[i]
+		}
+	}
+	return nil
+}
+
+// isRawElem reports whether e is a type that already holds pre-encoded
+// bytes wholesale: either a plain []byte or msgp.Raw (which resolves to an
+// IDENT aliased "msgp.Raw", since it isn't a Primitive of its own).
+func isRawElem(e Elem) bool {
+	be, ok := e.(*BaseElem)
+	if !ok {
+		return false
+	}
+	return be.Value == Bytes || (be.Value == IDENT && be.TypeName() == "msgp.Raw")
+}
+
+// ValidateExtra enforces the rules around the `,extra` catch-all field:
+// a struct may declare at most one, and it is meaningless (and therefore
+// rejected) on AsTuple structs, since those are encoded positionally and
+// have no notion of an unrecognized map key. The field itself must be
+// either a map[string][]byte/map[string]msgp.Raw (unknown keys preserved
+// individually, keyed by their original map key) or a bare msgp.Raw or
+// []byte (unknown keys preserved as one undifferentiated run of raw key+value
+// pairs), since those are the only shapes a generic printer can replay
+// verbatim on the next encode without decoding into a Go value it has no
+// generic way to re-encode.
+func (s *Struct) ValidateExtra() error {
+	n := s.CountFieldTagPart("extra")
+	if n == 0 {
+		return nil
+	}
+	if n > 1 {
+		return fmt.Errorf("msgp: struct %q has %d fields tagged \",extra\"; only one is allowed", s.TypeName(), n)
+	}
+	if s.AsTuple {
+		return fmt.Errorf("msgp: struct %q cannot combine \",extra\" with AsTuple", s.TypeName())
+	}
+	extra := s.Extra()
+	const wantType = "must be a map[string][]byte, map[string]msgp.Raw, msgp.Raw, or []byte"
+	if m, ok := extra.FieldElem.(*Map); ok {
+		if !isRawElem(m.Value) {
+			return fmt.Errorf("msgp: struct %q field %q tagged \",extra\" %s", s.TypeName(), extra.FieldName, wantType)
+		}
+		return nil
+	}
+	if !isRawElem(extra.FieldElem) {
+		return fmt.Errorf("msgp: struct %q field %q tagged \",extra\" %s", s.TypeName(), extra.FieldName, wantType)
+	}
+	return nil
+}
+
 type StructField struct {
 	FieldTag      string   // the string inside the `msg:""` tag up to the first comma
 	FieldTagParts []string // the string inside the `msg:""` tag split by commas
@@ -559,6 +665,27 @@ func (sf *StructField) HasTagPart(pname string) bool {
 	return false
 }
 
+// CBORKey returns the integer map key to use for this field when generating
+// CBOR output, as set by a `cbor:key=N` tag part, and whether one was present.
+// Fields without the option keep their string FieldTag when encoded as a
+// CBOR map.
+func (sf *StructField) CBORKey() (uint64, bool) {
+	const prefix = "cbor:key="
+	if len(sf.FieldTagParts) < 2 {
+		return 0, false
+	}
+	for _, p := range sf.FieldTagParts[1:] {
+		if strings.HasPrefix(p, prefix) {
+			n, err := strconv.ParseUint(p[len(prefix):], 10, 64)
+			if err != nil {
+				return 0, false
+			}
+			return n, true
+		}
+	}
+	return 0, false
+}
+
 type ShimMode int
 
 const (
@@ -662,6 +789,9 @@ func (s *BaseElem) BaseName() string {
 	if s.Value == JsonNumber {
 		return "JSONNumber"
 	}
+	if s.Value == Decimal {
+		return "Decimal"
+	}
 	return s.Value.String()
 }
 
@@ -684,6 +814,12 @@ func (s *BaseElem) BaseType() string {
 		return "json.Number"
 	case Ext:
 		return "msgp.Extension"
+	case BigInt:
+		return "big.Int"
+	case BigFloat:
+		return "big.Float"
+	case Decimal:
+		return decimalIdent
 
 	// everything else is base.String() with
 	// the first letter as lowercase
@@ -757,6 +893,14 @@ func (s *BaseElem) ZeroExpr() string {
 		return "nil"
 	}
 
+	// BigInt/BigFloat have no generically-known zero value: BaseType
+	// declares the field as the value type (big.Int/big.Float, per
+	// big.Int's own doc that shallow copies are not supported), and
+	// those types contain an unexported slice that can't be compared
+	// with ==, so there is no safe IfZeroExpr to emit. Decimal is the
+	// same story one level removed: it depends on the pluggable type
+	// registered via -decimal-type, which isn't known to be comparable
+	// either. All three simply don't support `,omitempty`.
 	return ""
 }
 
@@ -817,6 +961,12 @@ func (k Primitive) String() string {
 		return "Extension"
 	case JsonNumber:
 		return "json.Number"
+	case BigInt:
+		return "BigInt"
+	case BigFloat:
+		return "BigFloat"
+	case Decimal:
+		return "Decimal"
 	case IDENT:
 		return "Ident"
 	default:
@@ -0,0 +1,257 @@
+package gen
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// FastpathEnabled controls whether the generator rewrites Slice/Map nodes
+// whose child is a whitelisted BaseElem into calls to a shared
+// encFastpath_*/decFastpath_* helper instead of inlining a per-element
+// read/write loop at every call site. It is set from the generator's
+// `-fastpath` command-line flag, via Options.Apply.
+var FastpathEnabled bool
+
+// fastpathElem describes how to read/write one element of a whitelisted
+// fastpath kind using the byte-slice cbor.AppendXxx/ReadXxxBytes API (the
+// same functions genEncodeBase/genDecodeBase call inline). wireType is the
+// Go type readFn actually returns; it only differs from goType for Int,
+// where the wire representation is always int64.
+type fastpathElem struct {
+	goType   string
+	wireType string
+	appendFn string
+	readFn   string
+}
+
+var fastpathElems = map[Primitive]fastpathElem{
+	String:  {goType: "string", wireType: "string", appendFn: "AppendString", readFn: "ReadStringBytes"},
+	Int:     {goType: "int", wireType: "int64", appendFn: "AppendInt", readFn: "ReadIntBytes"},
+	Int64:   {goType: "int64", wireType: "int64", appendFn: "AppendInt", readFn: "ReadIntBytes"},
+	Uint64:  {goType: "uint64", wireType: "uint64", appendFn: "AppendUint", readFn: "ReadUintBytes"},
+	Float64: {goType: "float64", wireType: "float64", appendFn: "AppendFloat64", readFn: "ReadFloat64Bytes"},
+	Bool:    {goType: "bool", wireType: "bool", appendFn: "AppendBool", readFn: "ReadBoolBytes"},
+	Bytes:   {goType: "[]byte", wireType: "[]byte", appendFn: "AppendBytes", readFn: "ReadBytesBytes"},
+}
+
+// fastpathSliceKinds and fastpathMapKinds are the whitelist of leaf
+// Primitive kinds common enough to be worth a single shared helper. Adding
+// an entry here means every matching []T / map[string]T field in every
+// generated file calls the same encFastpath_.../decFastpath_... function
+// rather than each emitting its own inline append/read loop, which is the
+// same rationale the ugorji codec uses for its fastpath table: smaller
+// generated binaries, better icache behavior, and one spot to hand-tune
+// the hot loop for a given type. Intf has no entry: the CBOR backend has
+// no generic interface{} encoding to share (see genEncodeBase's Intf/Ext
+// case), so there is nothing for a fastpath helper to call.
+var (
+	fastpathSliceKinds = map[Primitive]string{
+		String:  "SliceString",
+		Int:     "SliceInt",
+		Int64:   "SliceInt64",
+		Uint64:  "SliceUint64",
+		Float64: "SliceFloat64",
+		Bool:    "SliceBool",
+		Bytes:   "SliceBytes",
+	}
+
+	fastpathMapKinds = map[Primitive]string{
+		String: "MapStringString",
+		Int64:  "MapStringInt64",
+	}
+
+	// fastpathSliceValue and fastpathMapValue invert the maps above, so
+	// EmitFastpathHelpers can go from a kind name back to the element
+	// Primitive it needs to generate a body for.
+	fastpathSliceValue = invertKinds(fastpathSliceKinds)
+	fastpathMapValue   = invertKinds(fastpathMapKinds)
+)
+
+func invertKinds(m map[Primitive]string) map[string]Primitive {
+	out := make(map[string]Primitive, len(m))
+	for p, kind := range m {
+		out[kind] = p
+	}
+	return out
+}
+
+// usedFastpathKinds tracks, for the file currently being generated, which
+// fastpath helper kinds were actually referenced, so EmitFastpathHelpers
+// can emit each one's shared encFastpath_*/decFastpath_* pair exactly once
+// per output file rather than once per call site.
+var usedFastpathKinds = map[string]bool{}
+
+// ResetFastpathUsage clears the used-kind tracking. The driver calls this
+// once before generating each output file.
+func ResetFastpathUsage() { usedFastpathKinds = map[string]bool{} }
+
+// fastpathSliceKind returns the suffix used to build the
+// encFastpath_Slice*/decFastpath_Slice* helper names for a []Primitive, or
+// "" if p isn't whitelisted or fastpath generation is disabled. A non-empty
+// result marks kind as used, for EmitFastpathHelpers.
+func fastpathSliceKind(p Primitive) string {
+	if !FastpathEnabled {
+		return ""
+	}
+	kind := fastpathSliceKinds[p]
+	if kind != "" {
+		usedFastpathKinds[kind] = true
+	}
+	return kind
+}
+
+// fastpathMapKind returns the suffix used to build the
+// encFastpath_Map*/decFastpath_Map* helper names for a map[string]Primitive,
+// or "" if p isn't whitelisted or fastpath generation is disabled. A
+// non-empty result marks kind as used, for EmitFastpathHelpers.
+func fastpathMapKind(p Primitive) string {
+	if !FastpathEnabled {
+		return ""
+	}
+	kind := fastpathMapKinds[p]
+	if kind != "" {
+		usedFastpathKinds[kind] = true
+	}
+	return kind
+}
+
+// fastpathEncFunc returns the package-level helper that encodes a value of
+// the given fastpath kind, e.g. "encFastpath_SliceString".
+func fastpathEncFunc(kind string) string {
+	return "encFastpath_" + kind
+}
+
+// fastpathDecFunc returns the package-level helper that decodes a value of
+// the given fastpath kind, e.g. "decFastpath_SliceString".
+func fastpathDecFunc(kind string) string {
+	return "decFastpath_" + kind
+}
+
+// EmitFastpathHelpers writes the encFastpath_*/decFastpath_* helper function
+// pair for every kind referenced since the last ResetFastpathUsage, in
+// deterministic (sorted) order. The driver calls this once per output file,
+// after all of that file's types have been generated, so the helpers follow
+// the CBOR MarshalCBOR/UnmarshalCBOR methods that call them.
+func EmitFastpathHelpers(w io.Writer) error {
+	kinds := make([]string, 0, len(usedFastpathKinds))
+	for kind := range usedFastpathKinds {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		var err error
+		if p, ok := fastpathSliceValue[kind]; ok {
+			err = writeSliceFastpath(w, kind, p)
+		} else if p, ok := fastpathMapValue[kind]; ok {
+			err = writeMapFastpath(w, kind, p)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fastpathReadArg returns the extra argument list passed to readFn beyond
+// the input []byte, and fastpathCast returns the expression that converts
+// a decoded wireType value x into goType. Only Bytes and Int need either.
+func fastpathReadArg(el fastpathElem) string {
+	if el.goType == "[]byte" {
+		return ", nil"
+	}
+	return ""
+}
+
+func fastpathCast(el fastpathElem, expr string) string {
+	if el.goType == el.wireType {
+		return expr
+	}
+	return fmt.Sprintf("%s(%s)", el.goType, expr)
+}
+
+// fastpathWireCast is the encode-side counterpart of fastpathCast: it
+// converts a goType value into the wireType that appendFn takes.
+func fastpathWireCast(el fastpathElem, expr string) string {
+	if el.goType == el.wireType {
+		return expr
+	}
+	return fmt.Sprintf("%s(%s)", el.wireType, expr)
+}
+
+func writeSliceFastpath(w io.Writer, kind string, p Primitive) error {
+	el := fastpathElems[p]
+	_, err := fmt.Fprintf(w, `// %[1]s is the shared fastpath helper generated for every []%[2]s
+// field in this package, in place of an inlined per-element append loop.
+func %[1]s(b []byte, v []%[2]s) []byte {
+	b = cbor.AppendArrayHeader(b, uint64(len(v)))
+	for _, x := range v {
+		b = cbor.%[3]s(b, %[4]s)
+	}
+	return b
+}
+
+// %[5]s is the decode counterpart of %[1]s.
+func %[5]s(b []byte) ([]%[2]s, []byte, error) {
+	sz, b, err := cbor.ReadArrayHeaderBytes(b)
+	if err != nil {
+		return nil, b, err
+	}
+	v := make([]%[2]s, sz)
+	for i := range v {
+		var x %[6]s
+		x, b, err = cbor.%[7]s(b%[8]s)
+		if err != nil {
+			return nil, b, err
+		}
+		v[i] = %[9]s
+	}
+	return v, b, nil
+}
+
+`, fastpathEncFunc(kind), el.goType, el.appendFn, fastpathWireCast(el, "x"),
+		fastpathDecFunc(kind), el.wireType, el.readFn, fastpathReadArg(el), fastpathCast(el, "x"))
+	return err
+}
+
+func writeMapFastpath(w io.Writer, kind string, p Primitive) error {
+	el := fastpathElems[p]
+	_, err := fmt.Fprintf(w, `// %[1]s is the shared fastpath helper generated for every
+// map[string]%[2]s field in this package, in place of an inlined
+// per-entry append loop.
+func %[1]s(b []byte, v map[string]%[2]s) []byte {
+	b = cbor.AppendMapHeader(b, uint64(len(v)))
+	for k, x := range v {
+		b = cbor.AppendString(b, k)
+		b = cbor.%[3]s(b, %[4]s)
+	}
+	return b
+}
+
+// %[5]s is the decode counterpart of %[1]s.
+func %[5]s(b []byte) (map[string]%[2]s, []byte, error) {
+	sz, b, err := cbor.ReadMapHeaderBytes(b)
+	if err != nil {
+		return nil, b, err
+	}
+	v := make(map[string]%[2]s, sz)
+	for i := uint64(0); i < sz; i++ {
+		var k string
+		k, b, err = cbor.ReadStringBytes(b)
+		if err != nil {
+			return nil, b, err
+		}
+		var x %[6]s
+		x, b, err = cbor.%[7]s(b%[8]s)
+		if err != nil {
+			return nil, b, err
+		}
+		v[k] = %[9]s
+	}
+	return v, b, nil
+}
+
+`, fastpathEncFunc(kind), el.goType, el.appendFn, fastpathWireCast(el, "x"),
+		fastpathDecFunc(kind), el.wireType, el.readFn, fastpathReadArg(el), fastpathCast(el, "x"))
+	return err
+}
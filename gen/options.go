@@ -0,0 +1,22 @@
+package gen
+
+// Options bundles the command-line flags the generator's main package
+// parses and applies to this package's shared state for the duration of a
+// single run, before the parser and printers are invoked.
+type Options struct {
+	// CBOR enables the MarshalCBOR/UnmarshalCBOR method pair (-cbor).
+	CBOR bool
+
+	// Fastpath enables rewriting whitelisted []T/map[string]T fields to
+	// call a shared encFastpath_*/decFastpath_* helper pair instead of
+	// inlining a per-element loop at every call site (-fastpath). Only
+	// takes effect alongside CBOR; there is no other backend to wire it
+	// into yet.
+	Fastpath bool
+}
+
+// Apply wires o into the package-level state the printers consult.
+func (o Options) Apply() {
+	CBOREnabled = o.CBOR
+	FastpathEnabled = o.Fastpath
+}
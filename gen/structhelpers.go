@@ -0,0 +1,15 @@
+package gen
+
+// declaredFields returns s.Fields with the `,extra` catch-all (if any)
+// excluded. The catch-all is written/read separately from the declared
+// fields by whichever printer supports it (see Struct.Extra).
+func declaredFields(s *Struct) []StructField {
+	out := make([]StructField, 0, len(s.Fields))
+	for i := range s.Fields {
+		if s.Fields[i].HasTagPart("extra") {
+			continue
+		}
+		out = append(out, s.Fields[i])
+	}
+	return out
+}
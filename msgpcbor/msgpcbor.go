@@ -0,0 +1,276 @@
+// Package msgpcbor implements the handful of CBOR (RFC 8949) primitives the
+// generated MarshalCBOR/UnmarshalCBOR methods in the gen package's CBOR
+// backend call into. It deliberately mirrors the shape of the msgp package's
+// own AppendXxx/ReadXxxBytes API (append to and read from a []byte, no
+// intermediate io.Reader/Writer) so that generated code reads the same way
+// regardless of which wire format backend produced it.
+package msgpcbor
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// Major types, RFC 8949 section 3.1.
+const (
+	majorUint   = 0
+	majorNegInt = 1
+	majorBytes  = 2
+	majorText   = 3
+	majorArray  = 4
+	majorMap    = 5
+	majorTag    = 6
+	majorSimple = 7
+)
+
+// Simple values/float widths under major type 7.
+const (
+	simpleFalse   = 20
+	simpleTrue    = 21
+	simpleNil     = 22
+	simpleFloat32 = 26
+	simpleFloat64 = 27
+)
+
+// ErrShortBytes is returned when b does not contain a complete encoded value.
+var ErrShortBytes = errors.New("msgpcbor: too few bytes to read object")
+
+// appendHead appends the major/additional-info head for an argument n,
+// choosing the shortest encoding per RFC 8949 section 3.
+func appendHead(b []byte, major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return append(b, major<<5|byte(n))
+	case n <= 0xff:
+		return append(b, major<<5|24, byte(n))
+	case n <= 0xffff:
+		return append(append(b, major<<5|25), byte(n>>8), byte(n))
+	case n <= 0xffffffff:
+		var tmp [4]byte
+		binary.BigEndian.PutUint32(tmp[:], uint32(n))
+		return append(append(b, major<<5|26), tmp[:]...)
+	default:
+		var tmp [8]byte
+		binary.BigEndian.PutUint64(tmp[:], n)
+		return append(append(b, major<<5|27), tmp[:]...)
+	}
+}
+
+// readHead reads the major type and argument of the next head in b,
+// returning the remaining bytes after it.
+func readHead(b []byte) (major byte, n uint64, o []byte, err error) {
+	if len(b) < 1 {
+		return 0, 0, b, ErrShortBytes
+	}
+	major = b[0] >> 5
+	info := b[0] & 0x1f
+	switch {
+	case info < 24:
+		return major, uint64(info), b[1:], nil
+	case info == 24:
+		if len(b) < 2 {
+			return 0, 0, b, ErrShortBytes
+		}
+		return major, uint64(b[1]), b[2:], nil
+	case info == 25:
+		if len(b) < 3 {
+			return 0, 0, b, ErrShortBytes
+		}
+		return major, uint64(binary.BigEndian.Uint16(b[1:3])), b[3:], nil
+	case info == 26:
+		if len(b) < 5 {
+			return 0, 0, b, ErrShortBytes
+		}
+		return major, uint64(binary.BigEndian.Uint32(b[1:5])), b[5:], nil
+	case info == 27:
+		if len(b) < 9 {
+			return 0, 0, b, ErrShortBytes
+		}
+		return major, binary.BigEndian.Uint64(b[1:9]), b[9:], nil
+	default:
+		return 0, 0, b, errors.New("msgpcbor: unsupported additional info")
+	}
+}
+
+var errMajorMismatch = errors.New("msgpcbor: unexpected major type")
+
+func expectMajor(b []byte, want byte) (uint64, []byte, error) {
+	major, n, o, err := readHead(b)
+	if err != nil {
+		return 0, b, err
+	}
+	if major != want {
+		return 0, b, errMajorMismatch
+	}
+	return n, o, nil
+}
+
+// AppendMapHeader appends a map head for sz entries.
+func AppendMapHeader(b []byte, sz uint64) []byte { return appendHead(b, majorMap, sz) }
+
+// AppendArrayHeader appends an array head for sz elements.
+func AppendArrayHeader(b []byte, sz uint64) []byte { return appendHead(b, majorArray, sz) }
+
+// AppendTag appends a tag head carrying tag number n.
+func AppendTag(b []byte, n uint64) []byte { return appendHead(b, majorTag, n) }
+
+// AppendUint appends an unsigned integer.
+func AppendUint(b []byte, u uint64) []byte { return appendHead(b, majorUint, u) }
+
+// AppendInt appends a signed integer, choosing major type 0 or 1 by sign.
+func AppendInt(b []byte, i int64) []byte {
+	if i >= 0 {
+		return appendHead(b, majorUint, uint64(i))
+	}
+	return appendHead(b, majorNegInt, uint64(-1-i))
+}
+
+// AppendString appends a CBOR text string.
+func AppendString(b []byte, s string) []byte {
+	b = appendHead(b, majorText, uint64(len(s)))
+	return append(b, s...)
+}
+
+// AppendBytes appends a CBOR byte string.
+func AppendBytes(b []byte, v []byte) []byte {
+	b = appendHead(b, majorBytes, uint64(len(v)))
+	return append(b, v...)
+}
+
+// AppendBool appends a CBOR boolean simple value.
+func AppendBool(b []byte, v bool) []byte {
+	if v {
+		return append(b, majorSimple<<5|simpleTrue)
+	}
+	return append(b, majorSimple<<5|simpleFalse)
+}
+
+// AppendNil appends the CBOR null simple value.
+func AppendNil(b []byte) []byte {
+	return append(b, majorSimple<<5|simpleNil)
+}
+
+// AppendFloat64 appends an IEEE 754 double.
+func AppendFloat64(b []byte, f float64) []byte {
+	var tmp [8]byte
+	binary.BigEndian.PutUint64(tmp[:], math.Float64bits(f))
+	return append(append(b, majorSimple<<5|simpleFloat64), tmp[:]...)
+}
+
+// ReadMapHeaderBytes reads a map head and returns its entry count.
+func ReadMapHeaderBytes(b []byte) (uint64, []byte, error) { return expectMajor(b, majorMap) }
+
+// ReadArrayHeaderBytes reads an array head and returns its element count.
+func ReadArrayHeaderBytes(b []byte) (uint64, []byte, error) { return expectMajor(b, majorArray) }
+
+// ReadTagBytes reads a tag head and returns its tag number.
+func ReadTagBytes(b []byte) (uint64, []byte, error) { return expectMajor(b, majorTag) }
+
+// ReadUintBytes reads an unsigned integer.
+func ReadUintBytes(b []byte) (uint64, []byte, error) { return expectMajor(b, majorUint) }
+
+// ReadIntBytes reads a signed integer of either major type.
+func ReadIntBytes(b []byte) (int64, []byte, error) {
+	major, n, o, err := readHead(b)
+	if err != nil {
+		return 0, b, err
+	}
+	switch major {
+	case majorUint:
+		return int64(n), o, nil
+	case majorNegInt:
+		return -1 - int64(n), o, nil
+	default:
+		return 0, b, errors.New("msgpcbor: expected an integer")
+	}
+}
+
+// ReadStringBytes reads a CBOR text string.
+func ReadStringBytes(b []byte) (string, []byte, error) {
+	n, o, err := expectMajor(b, majorText)
+	if err != nil {
+		return "", b, err
+	}
+	if uint64(len(o)) < n {
+		return "", b, ErrShortBytes
+	}
+	return string(o[:n]), o[n:], nil
+}
+
+// ReadBytesBytes reads a CBOR byte string, copying it into scratch's storage
+// (overwriting from index 0, growing it as needed) if given.
+func ReadBytesBytes(b []byte, scratch []byte) ([]byte, []byte, error) {
+	n, o, err := expectMajor(b, majorBytes)
+	if err != nil {
+		return nil, b, err
+	}
+	if uint64(len(o)) < n {
+		return nil, b, ErrShortBytes
+	}
+	out := append(scratch[:0], o[:n]...)
+	return out, o[n:], nil
+}
+
+// ReadBoolBytes reads a CBOR boolean simple value.
+func ReadBoolBytes(b []byte) (bool, []byte, error) {
+	n, o, err := expectMajor(b, majorSimple)
+	if err != nil {
+		return false, b, err
+	}
+	switch n {
+	case simpleTrue:
+		return true, o, nil
+	case simpleFalse:
+		return false, o, nil
+	default:
+		return false, b, errors.New("msgpcbor: expected a boolean")
+	}
+}
+
+// ReadFloat64Bytes reads an IEEE 754 double.
+func ReadFloat64Bytes(b []byte) (float64, []byte, error) {
+	n, o, err := expectMajor(b, majorSimple)
+	if err != nil {
+		return 0, b, err
+	}
+	return math.Float64frombits(n), o, nil
+}
+
+// Skip advances past one complete CBOR-encoded value, discarding it. It is
+// used by generated decode methods to skip values they don't recognize.
+func Skip(b []byte) ([]byte, error) {
+	major, n, o, err := readHead(b)
+	if err != nil {
+		return b, err
+	}
+	switch major {
+	case majorUint, majorNegInt, majorSimple:
+		return o, nil
+	case majorBytes, majorText:
+		if uint64(len(o)) < n {
+			return b, ErrShortBytes
+		}
+		return o[n:], nil
+	case majorArray:
+		for i := uint64(0); i < n; i++ {
+			o, err = Skip(o)
+			if err != nil {
+				return b, err
+			}
+		}
+		return o, nil
+	case majorMap:
+		for i := uint64(0); i < 2*n; i++ {
+			o, err = Skip(o)
+			if err != nil {
+				return b, err
+			}
+		}
+		return o, nil
+	case majorTag:
+		return Skip(o)
+	default:
+		return b, errors.New("msgpcbor: unsupported major type")
+	}
+}
@@ -0,0 +1,140 @@
+package msgpcbor
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestIntRoundTrip(t *testing.T) {
+	for _, i := range []int64{0, 1, 23, 24, 255, 256, 65535, 65536, 1<<32 - 1, 1 << 32, -1, -24, -25, -1000000} {
+		b := AppendInt(nil, i)
+		got, rest, err := ReadIntBytes(b)
+		if err != nil {
+			t.Fatalf("ReadIntBytes(%d): %v", i, err)
+		}
+		if len(rest) != 0 {
+			t.Fatalf("ReadIntBytes(%d): %d trailing bytes", i, len(rest))
+		}
+		if got != i {
+			t.Fatalf("ReadIntBytes(%d): got %d", i, got)
+		}
+	}
+}
+
+func TestStringRoundTrip(t *testing.T) {
+	for _, s := range []string{"", "a", "hello world", string(make([]byte, 300))} {
+		b := AppendString(nil, s)
+		got, rest, err := ReadStringBytes(b)
+		if err != nil {
+			t.Fatalf("ReadStringBytes(%q): %v", s, err)
+		}
+		if len(rest) != 0 {
+			t.Fatalf("ReadStringBytes(%q): trailing bytes", s)
+		}
+		if got != s {
+			t.Fatalf("ReadStringBytes(%q): got %q", s, got)
+		}
+	}
+}
+
+func TestBytesRoundTrip(t *testing.T) {
+	v := []byte{1, 2, 3, 4, 5}
+	b := AppendBytes(nil, v)
+	got, rest, err := ReadBytesBytes(b, nil)
+	if err != nil {
+		t.Fatalf("ReadBytesBytes: %v", err)
+	}
+	if len(rest) != 0 {
+		t.Fatalf("ReadBytesBytes: trailing bytes")
+	}
+	if !bytes.Equal(got, v) {
+		t.Fatalf("ReadBytesBytes: got %v want %v", got, v)
+	}
+}
+
+func TestBoolRoundTrip(t *testing.T) {
+	for _, v := range []bool{true, false} {
+		b := AppendBool(nil, v)
+		got, _, err := ReadBoolBytes(b)
+		if err != nil {
+			t.Fatalf("ReadBoolBytes(%v): %v", v, err)
+		}
+		if got != v {
+			t.Fatalf("ReadBoolBytes(%v): got %v", v, got)
+		}
+	}
+}
+
+func TestFloat64RoundTrip(t *testing.T) {
+	for _, f := range []float64{0, 1.5, -1.5, math.Pi, math.Inf(1)} {
+		b := AppendFloat64(nil, f)
+		got, _, err := ReadFloat64Bytes(b)
+		if err != nil {
+			t.Fatalf("ReadFloat64Bytes(%v): %v", f, err)
+		}
+		if got != f {
+			t.Fatalf("ReadFloat64Bytes(%v): got %v", f, got)
+		}
+	}
+}
+
+func TestTagRoundTrip(t *testing.T) {
+	b := AppendTag(nil, 100)
+	b = AppendBytes(b, []byte("payload"))
+	tag, rest, err := ReadTagBytes(b)
+	if err != nil {
+		t.Fatalf("ReadTagBytes: %v", err)
+	}
+	if tag != 100 {
+		t.Fatalf("ReadTagBytes: got %d", tag)
+	}
+	payload, rest, err := ReadBytesBytes(rest, nil)
+	if err != nil {
+		t.Fatalf("ReadBytesBytes: %v", err)
+	}
+	if string(payload) != "payload" {
+		t.Fatalf("payload mismatch: %q", payload)
+	}
+	if len(rest) != 0 {
+		t.Fatalf("trailing bytes after tag+payload")
+	}
+}
+
+func TestMapArrayHeaderRoundTrip(t *testing.T) {
+	b := AppendMapHeader(nil, 3)
+	sz, _, err := ReadMapHeaderBytes(b)
+	if err != nil || sz != 3 {
+		t.Fatalf("ReadMapHeaderBytes: sz=%d err=%v", sz, err)
+	}
+	b = AppendArrayHeader(nil, 5)
+	sz, _, err = ReadArrayHeaderBytes(b)
+	if err != nil || sz != 5 {
+		t.Fatalf("ReadArrayHeaderBytes: sz=%d err=%v", sz, err)
+	}
+}
+
+func TestSkip(t *testing.T) {
+	var b []byte
+	b = AppendMapHeader(b, 2)
+	b = AppendString(b, "a")
+	b = AppendInt(b, 1)
+	b = AppendString(b, "b")
+	b = AppendArrayHeader(b, 2)
+	b = AppendBool(b, true)
+	b = AppendBytes(b, []byte{9, 9})
+	rest, err := Skip(b)
+	if err != nil {
+		t.Fatalf("Skip: %v", err)
+	}
+	if len(rest) != 0 {
+		t.Fatalf("Skip: left %d trailing bytes", len(rest))
+	}
+}
+
+func TestReadWrongMajorType(t *testing.T) {
+	b := AppendString(nil, "x")
+	if _, _, err := ReadIntBytes(b); err == nil {
+		t.Fatalf("expected error reading int from a string head")
+	}
+}